@@ -5,7 +5,7 @@ package notification
 
 import (
 	"context"
-	"net"
+	"sync"
 
 	"github.com/zeebo/errs"
 	"go.uber.org/zap"
@@ -35,68 +35,74 @@ func (endpoint *Endpoint) DRPC() pb.DRPCNotificationServer {
 	return &drpcEndpoint{Endpoint: endpoint}
 }
 
-// ProcessNotification sends message to the specified set of nodes (ids)
+// ProcessNotification routes message to whichever transports apply to it,
+// respecting each transport's rate limit, and sends it through all of them.
 func (endpoint *Endpoint) ProcessNotification(ctx context.Context, message *pb.NotificationMessage) (msg *pb.NotificationResponse, err error) {
-	var eSent, rSent = false, false
 	endpoint.log.Debug("sending to node", zap.String("address", message.Address), zap.String("message", string(message.Message)))
-	if endpoint.service.CheckRPCLimit(message.NodeId.String()) {
-		msg, err = endpoint.processNotificationRPC(ctx, message)
-		if err != nil {
-			return msg, err
-		}
-		rSent = true
-	}
-	if endpoint.service.CheckEmailLimit(message.NodeId.String()) {
-		err = endpoint.processNotificationEmail(ctx, message)
-		if err != nil {
-			return msg, err
-		}
-		eSent = true
-	}
-	endpoint.service.IncrementLimiter(message.NodeId.String(), eSent, rSent)
-	return msg, nil
-}
 
-func (endpoint *Endpoint) processNotificationRPC(ctx context.Context, message *pb.NotificationMessage) (_ *pb.NotificationResponse, err error) {
-	client, err := newClient(ctx, endpoint.service.dialer, message.Address, message.NodeId)
-	if err != nil {
-		// if this is a network error, then return the error otherwise just report internal error
-		_, ok := err.(net.Error)
-		if ok {
-			return &pb.NotificationResponse{}, Error.New("failed to connect to %s: %v", message.Address, err)
+	msg = &pb.NotificationResponse{}
+	sent := make(map[string]bool, len(endpoint.service.transports))
+
+	for _, transport := range endpoint.service.routeNotification(message) {
+		if !endpoint.service.CheckTransportLimit(transport.Name(), message.NodeId.String()) {
+			continue
 		}
-		endpoint.log.Warn("internal error", zap.String("error", err.Error()))
-		return &pb.NotificationResponse{}, Error.New("couldn't connect to client at addr: %s due to internal error.", message.Address)
+		if sendErr := transport.Send(ctx, Message{
+			NodeID:   message.NodeId,
+			Address:  message.Address,
+			Severity: message.Loglevel,
+			Body:     message.Message,
+		}); sendErr != nil {
+			endpoint.log.Warn("transport failed to send notification",
+				zap.String("transport", transport.Name()), zap.Error(sendErr))
+			err = errs.Combine(err, sendErr)
+			continue
+		}
+		sent[transport.Name()] = true
 	}
-	defer func() { err = errs.Combine(err, client.Close()) }()
-
-	return client.client.ProcessNotification(ctx, message)
-}
 
-func (endpoint *Endpoint) processNotificationEmail(ctx context.Context, message *pb.NotificationMessage) (err error) {
-	//return endpoint.service.mailer.Send(ctx, &post.Message{})
-	return nil
+	endpoint.service.IncrementLimiter(message.NodeId.String(), sent)
+	return msg, err
 }
 
-func (endpoint *Endpoint) sendBroadcastNotification(ctx context.Context, message string, ids []pb.Node) {
+// BroadcastNotification fans the given message out to every node in ids
+// concurrently, rather than the one-at-a-time loop this replaced.
+//
+// This is not yet exposed as a DRPC method: that needs a
+// BroadcastNotificationRequest/Response pair added to the notification
+// proto and DRPCNotificationServer regenerated, plus this Endpoint
+// registered against the result, none of which is in scope for this
+// chunk. Call it directly in-process until that lands.
+func (endpoint *Endpoint) BroadcastNotification(ctx context.Context, message string, ids []pb.Node) {
+	var mu sync.Mutex
 	var sentCount int
 	var failed []string
 
+	var wg sync.WaitGroup
 	for _, node := range ids {
-		// RPC Message
-		mess := &pb.NotificationMessage{
-			NodeId:   node.Id,
-			Address:  node.Address.Address,
-			Loglevel: pb.LogLevel_INFO,
-			Message:  []byte(message),
-		}
-
-		_, err := endpoint.ProcessNotification(ctx, mess)
-		if err != nil {
-			failed = append(failed, node.Id.String())
-		}
-		sentCount++
+		node := node
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			mess := &pb.NotificationMessage{
+				NodeId:   node.Id,
+				Address:  node.Address.Address,
+				Loglevel: pb.LogLevel_INFO,
+				Message:  []byte(message),
+			}
+
+			_, err := endpoint.ProcessNotification(ctx, mess)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed = append(failed, node.Id.String())
+			}
+			sentCount++
+		}()
 	}
+	wg.Wait()
 
 	endpoint.log.Info("sent to nodes", zap.Int("count", sentCount))
 	endpoint.log.Debug("notification to the following nodes failed", zap.Strings("nodeIDs", failed))
@@ -0,0 +1,206 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package notification
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+	"go.uber.org/zap"
+
+	"storj.io/common/rpc"
+	"storj.io/storj/pkg/pb"
+)
+
+// Error is a standard error class for this package.
+var Error = errs.Class("notification error")
+
+// Config contains configurable values for the notification service.
+type Config struct {
+	RPCLimit             int           `help:"maximum DRPC notifications per node per interval" default:"5"`
+	EmailLimit           int           `help:"maximum emails per node per interval" default:"1"`
+	LimitInterval        time.Duration `help:"interval over which RPCLimit and EmailLimit are enforced" default:"1h0m0s"`
+	WebhookURL           string        `help:"URL of the HTTP webhook to deliver notifications to, if any"`
+	WebhookSecret        string        `help:"shared secret used to HMAC-sign webhook payloads"`
+	WebhookLimit         int           `help:"maximum webhook deliveries per node per interval" default:"10"`
+	WebhookSeverityFloor pb.LogLevel   `help:"minimum severity that is routed to the webhook" default:"0"`
+	SlackWebhookURL      string        `help:"URL of the Slack incoming webhook to deliver notifications to, if any"`
+	SlackLimit           int           `help:"maximum Slack deliveries per node per interval" default:"10"`
+	SlackSeverityFloor   pb.LogLevel   `help:"minimum severity that is routed to Slack" default:"2"`
+	EmailSeverityFloor   pb.LogLevel   `help:"minimum severity that is routed to SMTP" default:"1"`
+}
+
+// Service sends notifications to storage nodes and operators through one
+// or more Transports, selected per-notification via routing rules, and
+// rate limited per transport.
+//
+// architecture: Service
+type Service struct {
+	log    *zap.Logger
+	dialer rpc.Dialer
+
+	config     Config
+	transports []Transport
+
+	mu          sync.Mutex
+	limiters    map[string]*transportLimiter
+	preferences map[string]map[string]bool // nodeID -> transport name -> disabled
+}
+
+// transportLimiter tracks how many notifications have been sent to a node
+// over the current interval, per transport.
+type transportLimiter struct {
+	windowStart time.Time
+	counts      map[string]int
+}
+
+// NewService creates a new notification service wired up with whichever
+// transports are configured: DRPC is always present, SMTP/webhook/Slack are
+// added only when their respective configuration is non-empty.
+func NewService(log *zap.Logger, dialer rpc.Dialer, mailer mailService, config Config) *Service {
+	transports := []Transport{&drpcTransport{dialer: dialer}}
+
+	if mailer != nil {
+		transports = append(transports, &smtpTransport{mailer: mailer})
+	}
+	if config.WebhookURL != "" {
+		transports = append(transports, &webhookTransport{
+			url:        config.WebhookURL,
+			secret:     []byte(config.WebhookSecret),
+			httpClient: http.DefaultClient,
+		})
+	}
+	if config.SlackWebhookURL != "" {
+		transports = append(transports, &slackTransport{
+			webhookURL: config.SlackWebhookURL,
+			httpClient: http.DefaultClient,
+		})
+	}
+
+	return &Service{
+		log:         log,
+		dialer:      dialer,
+		config:      config,
+		transports:  transports,
+		limiters:    make(map[string]*transportLimiter),
+		preferences: make(map[string]map[string]bool),
+	}
+}
+
+// SetNodePreference records whether nodeID wants to opt out of a given
+// transport entirely, overriding the severity floor for that transport.
+// This lets an operator mute, say, webhook delivery for one noisy node
+// without affecting its DRPC or email notifications.
+func (service *Service) SetNodePreference(nodeID string, transport string, disabled bool) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	prefs, ok := service.preferences[nodeID]
+	if !ok {
+		prefs = make(map[string]bool)
+		service.preferences[nodeID] = prefs
+	}
+	prefs[transport] = disabled
+}
+
+// routeNotification selects which transports a message should be sent
+// through: a transport is skipped if the message's severity is below that
+// transport's configured floor, or if the destination node has opted out
+// of that transport via SetNodePreference.
+func (service *Service) routeNotification(message *pb.NotificationMessage) []Transport {
+	nodeID := message.NodeId.String()
+
+	var selected []Transport
+	for _, transport := range service.transports {
+		if floor, ok := service.severityFloor(transport); ok && message.Loglevel < floor {
+			continue
+		}
+		if service.nodeDisabled(nodeID, transport.Name()) {
+			continue
+		}
+		selected = append(selected, transport)
+	}
+	return selected
+}
+
+// severityFloor returns the minimum severity configured for transport, and
+// whether transport is subject to a floor at all (DRPC is not: it is the
+// primary delivery mechanism and always applies).
+func (service *Service) severityFloor(transport Transport) (pb.LogLevel, bool) {
+	switch transport.(type) {
+	case *slackTransport:
+		return service.config.SlackSeverityFloor, true
+	case *smtpTransport:
+		return service.config.EmailSeverityFloor, true
+	case *webhookTransport:
+		return service.config.WebhookSeverityFloor, true
+	default:
+		return 0, false
+	}
+}
+
+// nodeDisabled reports whether nodeID has opted out of the named transport.
+func (service *Service) nodeDisabled(nodeID string, transport string) bool {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	return service.preferences[nodeID][transport]
+}
+
+// CheckTransportLimit reports whether nodeID is still within its rate
+// limit for the given transport, without consuming a slot. Call
+// IncrementLimiter after a successful send to consume it.
+func (service *Service) CheckTransportLimit(transport string, nodeID string) bool {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	limit := service.limitFor(transport)
+	if limit <= 0 {
+		return false
+	}
+
+	limiter := service.limiterFor(nodeID)
+	return limiter.counts[transport] < limit
+}
+
+// IncrementLimiter records that a notification was sent to nodeID through
+// each transport named in sent.
+func (service *Service) IncrementLimiter(nodeID string, sent map[string]bool) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	limiter := service.limiterFor(nodeID)
+	for transport, ok := range sent {
+		if ok {
+			limiter.counts[transport]++
+		}
+	}
+}
+
+func (service *Service) limiterFor(nodeID string) *transportLimiter {
+	limiter, ok := service.limiters[nodeID]
+	now := time.Now()
+	if !ok || now.Sub(limiter.windowStart) >= service.config.LimitInterval {
+		limiter = &transportLimiter{windowStart: now, counts: make(map[string]int)}
+		service.limiters[nodeID] = limiter
+	}
+	return limiter
+}
+
+func (service *Service) limitFor(transport string) int {
+	switch transport {
+	case "drpc":
+		return service.config.RPCLimit
+	case "smtp":
+		return service.config.EmailLimit
+	case "webhook":
+		return service.config.WebhookLimit
+	case "slack":
+		return service.config.SlackLimit
+	default:
+		return service.config.RPCLimit
+	}
+}
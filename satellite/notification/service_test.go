@@ -0,0 +1,87 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package notification
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"storj.io/common/testrand"
+	"storj.io/storj/pkg/pb"
+)
+
+func transportNames(transports []Transport) []string {
+	var names []string
+	for _, transport := range transports {
+		names = append(names, transport.Name())
+	}
+	return names
+}
+
+func TestRouteNotificationAppliesPerTransportSeverityFloors(t *testing.T) {
+	service := NewService(zap.NewNop(), nil, nil, Config{
+		WebhookURL:           "http://example.test/hook",
+		SlackWebhookURL:      "http://example.test/slack",
+		WebhookSeverityFloor: pb.LogLevel_WARN,
+		SlackSeverityFloor:   pb.LogLevel_ERROR,
+		EmailSeverityFloor:   pb.LogLevel_INFO,
+	})
+
+	low := &pb.NotificationMessage{NodeId: testrand.NodeID(), Loglevel: pb.LogLevel_INFO}
+	selected := transportNames(service.routeNotification(low))
+	require.Contains(t, selected, "drpc")
+	require.NotContains(t, selected, "webhook")
+	require.NotContains(t, selected, "slack")
+
+	high := &pb.NotificationMessage{NodeId: testrand.NodeID(), Loglevel: pb.LogLevel_ERROR}
+	selected = transportNames(service.routeNotification(high))
+	require.Contains(t, selected, "drpc")
+	require.Contains(t, selected, "webhook")
+	require.Contains(t, selected, "slack")
+}
+
+func TestRouteNotificationRespectsNodePreference(t *testing.T) {
+	service := NewService(zap.NewNop(), nil, nil, Config{
+		WebhookURL: "http://example.test/hook",
+	})
+
+	node := testrand.NodeID()
+	message := &pb.NotificationMessage{NodeId: node, Loglevel: pb.LogLevel_ERROR}
+
+	selected := transportNames(service.routeNotification(message))
+	require.Contains(t, selected, "webhook")
+
+	service.SetNodePreference(node.String(), "webhook", true)
+
+	selected = transportNames(service.routeNotification(message))
+	require.NotContains(t, selected, "webhook")
+	require.Contains(t, selected, "drpc", "disabling one transport must not affect others")
+}
+
+func TestRouteNotificationNodePreferenceIsPerNode(t *testing.T) {
+	service := NewService(zap.NewNop(), nil, nil, Config{
+		WebhookURL: "http://example.test/hook",
+	})
+
+	muted := testrand.NodeID()
+	other := testrand.NodeID()
+	service.SetNodePreference(muted.String(), "webhook", true)
+
+	mutedSelected := transportNames(service.routeNotification(&pb.NotificationMessage{NodeId: muted, Loglevel: pb.LogLevel_ERROR}))
+	require.NotContains(t, mutedSelected, "webhook")
+
+	otherSelected := transportNames(service.routeNotification(&pb.NotificationMessage{NodeId: other, Loglevel: pb.LogLevel_ERROR}))
+	require.Contains(t, otherSelected, "webhook")
+}
+
+func TestLimitForSlackUsesItsOwnLimitNotRPCLimit(t *testing.T) {
+	service := NewService(zap.NewNop(), nil, nil, Config{
+		RPCLimit:   5,
+		SlackLimit: 25,
+	})
+	require.Equal(t, 25, service.limitFor("slack"))
+	require.NotEqual(t, service.limitFor("drpc"), service.limitFor("slack"))
+}
@@ -0,0 +1,167 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package notification
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/zeebo/errs"
+
+	"storj.io/common/rpc"
+	"storj.io/common/storj"
+	"storj.io/storj/pkg/pb"
+	"storj.io/storj/satellite/mailservice/post"
+)
+
+// Message is the transport-agnostic content of a single notification,
+// assembled once by Endpoint and handed to whichever Transports are
+// selected for delivery.
+type Message struct {
+	NodeID   storj.NodeID
+	Address  string
+	Severity pb.LogLevel
+	Body     []byte
+}
+
+// Transport delivers a Message to its destination. Implementations are
+// free to ignore messages that don't apply to them (e.g. a webhook
+// transport with no endpoint configured for a given severity).
+type Transport interface {
+	// Name identifies the transport for rate limiting and logging.
+	Name() string
+	// Send delivers message, or returns an error if delivery failed.
+	Send(ctx context.Context, message Message) error
+}
+
+// drpcTransport delivers notifications directly to storage nodes over DRPC.
+// This is the original, and still default, delivery mechanism.
+type drpcTransport struct {
+	dialer rpc.Dialer
+}
+
+func (t *drpcTransport) Name() string { return "drpc" }
+
+func (t *drpcTransport) Send(ctx context.Context, message Message) (err error) {
+	client, err := newClient(ctx, t.dialer, message.Address, message.NodeID)
+	if err != nil {
+		if _, ok := err.(net.Error); ok {
+			return Error.New("failed to connect to %s: %v", message.Address, err)
+		}
+		return Error.New("couldn't connect to client at addr: %s due to internal error.", message.Address)
+	}
+	defer func() { err = errs.Combine(err, client.Close()) }()
+
+	_, err = client.client.ProcessNotification(ctx, &pb.NotificationMessage{
+		NodeId:   message.NodeID,
+		Address:  message.Address,
+		Loglevel: message.Severity,
+		Message:  message.Body,
+	})
+	return err
+}
+
+// smtpTransport delivers notifications as email through the satellite's
+// mailer.
+type smtpTransport struct {
+	mailer mailService
+}
+
+// mailService is the subset of mailer.Sender that smtpTransport depends on.
+type mailService interface {
+	Send(ctx context.Context, msg *post.Message) error
+}
+
+func (t *smtpTransport) Name() string { return "smtp" }
+
+func (t *smtpTransport) Send(ctx context.Context, message Message) error {
+	if t.mailer == nil {
+		return Error.New("smtp transport configured without a mailer")
+	}
+	return t.mailer.Send(ctx, &post.Message{
+		Subject:   "Storage node notification",
+		PlainText: string(message.Body),
+	})
+}
+
+// webhookTransport delivers notifications to a generic HTTP endpoint,
+// signing the payload with HMAC-SHA256 so receivers can verify origin.
+type webhookTransport struct {
+	url        string
+	secret     []byte
+	httpClient *http.Client
+}
+
+func (t *webhookTransport) Name() string { return "webhook" }
+
+func (t *webhookTransport) Send(ctx context.Context, message Message) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, strings.NewReader(string(payload)))
+	if err != nil {
+		return Error.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Storj-Signature", signPayload(t.secret, payload))
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		return Error.New("webhook %s responded with status %d", t.url, resp.StatusCode)
+	}
+	return nil
+}
+
+func signPayload(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// slackTransport delivers notifications to a Slack incoming webhook.
+type slackTransport struct {
+	webhookURL string
+	httpClient *http.Client
+}
+
+func (t *slackTransport) Name() string { return "slack" }
+
+func (t *slackTransport) Send(ctx context.Context, message Message) error {
+	payload, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{Text: string(message.Body)})
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.webhookURL, strings.NewReader(string(payload)))
+	if err != nil {
+		return Error.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		return Error.New("slack webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"storj.io/storj/satellite/internalpb"
+	"storj.io/storj/storage"
+)
+
+// Error is a standard error class for this package.
+var Error = errs.Class("repair queue error")
+
+// memQueue is an in-memory RepairQueue. It's primarily useful for tests;
+// the production queue is backed by the satellite's metainfo database.
+type memQueue struct {
+	mu         sync.Mutex
+	items      []*QueuedSegment
+	deadLetter []*QueuedSegment
+}
+
+// NewMemQueue returns a new in-memory RepairQueue.
+func NewMemQueue() RepairQueue {
+	return &memQueue{}
+}
+
+func (q *memQueue) Insert(ctx context.Context, seg *internalpb.InjuredSegment, health Health) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.items = append(q.items, &QueuedSegment{InjuredSegment: seg, Health: health})
+	return nil
+}
+
+func (q *memQueue) Select(ctx context.Context, policy PriorityPolicy) (*QueuedSegment, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	best := -1
+	var bestScore float64
+	for i, item := range q.items {
+		if !item.NotBefore.IsZero() && item.NotBefore.After(now) {
+			continue
+		}
+		score := item.Health.Score(policy)
+		if best == -1 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best == -1 {
+		return nil, storage.ErrEmptyQueue.New("queue is empty")
+	}
+
+	seg := q.items[best]
+	q.items = append(q.items[:best], q.items[best+1:]...)
+	return seg, nil
+}
+
+func (q *memQueue) Delete(ctx context.Context, seg *internalpb.InjuredSegment) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.removeItemLocked(string(seg.GetPath()))
+	return nil
+}
+
+func (q *memQueue) Reschedule(ctx context.Context, seg *QueuedSegment, notBefore time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	seg.NotBefore = notBefore
+	q.items = append(q.items, seg)
+	return nil
+}
+
+func (q *memQueue) MoveToDeadLetter(ctx context.Context, seg *QueuedSegment, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.removeItemLocked(string(seg.GetPath()))
+	seg.DeadLetterReason = reason
+	q.deadLetter = append(q.deadLetter, seg)
+	return nil
+}
+
+func (q *memQueue) ListDeadLetter(ctx context.Context, limit int) ([]*QueuedSegment, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if limit <= 0 || limit > len(q.deadLetter) {
+		limit = len(q.deadLetter)
+	}
+	return append([]*QueuedSegment(nil), q.deadLetter[:limit]...), nil
+}
+
+func (q *memQueue) RetryDeadLetter(ctx context.Context, path string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, seg := range q.deadLetter {
+		if string(seg.GetPath()) == path {
+			q.deadLetter = append(q.deadLetter[:i], q.deadLetter[i+1:]...)
+			seg.AttemptCount = 0
+			seg.NotBefore = time.Time{}
+			seg.DeadLetterReason = ""
+			q.items = append(q.items, seg)
+			return nil
+		}
+	}
+	return Error.New("no dead-lettered segment found at path %q", path)
+}
+
+// removeItemLocked removes the first item matching path from q.items. The
+// caller must hold q.mu.
+func (q *memQueue) removeItemLocked(path string) {
+	for i, item := range q.items {
+		if string(item.GetPath()) == path {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return
+		}
+	}
+}
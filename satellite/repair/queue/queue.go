@@ -0,0 +1,110 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package queue
+
+import (
+	"context"
+	"time"
+
+	"storj.io/storj/satellite/internalpb"
+)
+
+// PriorityPolicy controls how Select orders segments waiting for repair.
+type PriorityPolicy string
+
+const (
+	// PriorityFIFO selects segments in the order they were queued, ignoring health.
+	PriorityFIFO PriorityPolicy = "fifo"
+	// PriorityHealth selects segments with the fewest healthy pieces remaining
+	// first, favoring segments with pieces on nodes flagged offline or
+	// gracefully-exiting.
+	PriorityHealth PriorityPolicy = "health"
+	// PriorityWeighted selects segments using a weighted score combining
+	// health, segment age, and object importance.
+	PriorityWeighted PriorityPolicy = "weighted"
+)
+
+// Health is a point-in-time snapshot of a queued segment's repair urgency.
+// It is stored alongside the segment so Select can order by it without
+// re-deriving it from the metainfo db on every poll.
+type Health struct {
+	NumHealthyPieces     int
+	PiecesRequired       int
+	NumOffline           int // pieces on nodes flagged offline
+	NumGracefullyExiting int // pieces on nodes that are gracefully exiting
+	QueuedAt             time.Time
+	ObjectImportance     int // e.g. higher for metadata segments than large-object data
+}
+
+// Score returns an ordering value for h under policy; a higher score means
+// more urgent, and Select picks the highest-scoring eligible segment.
+// PriorityFIFO always returns zero, so Select falls back to arrival order.
+func (h Health) Score(policy PriorityPolicy) float64 {
+	switch policy {
+	case PriorityHealth:
+		return float64(h.PiecesRequired-h.NumHealthyPieces) + float64(h.NumOffline+h.NumGracefullyExiting)*0.5
+	case PriorityWeighted:
+		urgency := float64(h.PiecesRequired - h.NumHealthyPieces)
+		age := time.Since(h.QueuedAt).Hours()
+		return urgency + age*0.1 + float64(h.ObjectImportance)*2
+	default:
+		return 0
+	}
+}
+
+// Bucket quantizes h's score under policy into a small set of named urgency
+// buckets, suitable for tagging metrics without creating a high-cardinality
+// label. PriorityFIFO's score is always zero, so it always buckets as "low".
+func (h Health) Bucket(policy PriorityPolicy) string {
+	switch score := h.Score(policy); {
+	case score >= 8:
+		return "critical"
+	case score >= 4:
+		return "high"
+	case score >= 1:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// QueuedSegment is a segment popped from the repair queue together with
+// the repair-queue-owned bookkeeping that doesn't belong on the
+// metainfo-derived InjuredSegment itself: its health snapshot, how many
+// times repair has been attempted, when it next becomes eligible again,
+// and (once dead-lettered) why it was given up on.
+type QueuedSegment struct {
+	*internalpb.InjuredSegment
+
+	Health           Health
+	AttemptCount     int
+	NotBefore        time.Time
+	DeadLetterReason string
+}
+
+// RepairQueue stores segments that need repair, ordered for retrieval by
+// Select according to a PriorityPolicy, with support for exponential
+// backoff on repeatedly-failing segments and a dead letter queue for
+// segments that exceed their retry budget.
+type RepairQueue interface {
+	// Insert adds seg to the queue with the given health snapshot.
+	Insert(ctx context.Context, seg *internalpb.InjuredSegment, health Health) error
+	// Select pops the highest-priority eligible segment from the queue,
+	// according to policy. It returns storage.ErrEmptyQueue if nothing is
+	// eligible.
+	Select(ctx context.Context, policy PriorityPolicy) (*QueuedSegment, error)
+	// Delete removes seg from the queue; called once repair succeeds.
+	Delete(ctx context.Context, seg *internalpb.InjuredSegment) error
+	// Reschedule returns seg to the queue, making it ineligible for Select
+	// until notBefore. It does not change seg's attempt count.
+	Reschedule(ctx context.Context, seg *QueuedSegment, notBefore time.Time) error
+	// MoveToDeadLetter removes seg from the regular queue and records it in
+	// the dead letter queue along with reason.
+	MoveToDeadLetter(ctx context.Context, seg *QueuedSegment, reason string) error
+	// ListDeadLetter returns up to limit dead-lettered segments.
+	ListDeadLetter(ctx context.Context, limit int) ([]*QueuedSegment, error)
+	// RetryDeadLetter moves the dead-lettered segment at path back onto the
+	// regular queue, resetting its attempt count.
+	RetryDeadLetter(ctx context.Context, path string) error
+}
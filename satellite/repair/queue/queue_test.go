@@ -0,0 +1,123 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/storj/satellite/internalpb"
+	"storj.io/storj/storage"
+)
+
+func TestHealthScore(t *testing.T) {
+	unhealthy := Health{NumHealthyPieces: 2, PiecesRequired: 10}
+	healthy := Health{NumHealthyPieces: 9, PiecesRequired: 10}
+	require.Greater(t, unhealthy.Score(PriorityHealth), healthy.Score(PriorityHealth))
+
+	older := Health{NumHealthyPieces: 5, PiecesRequired: 10, QueuedAt: time.Now().Add(-48 * time.Hour)}
+	newer := Health{NumHealthyPieces: 5, PiecesRequired: 10, QueuedAt: time.Now()}
+	require.Greater(t, older.Score(PriorityWeighted), newer.Score(PriorityWeighted))
+
+	require.Equal(t, float64(0), unhealthy.Score(PriorityFIFO))
+}
+
+func TestHealthBucket(t *testing.T) {
+	require.Equal(t, "low", Health{}.Bucket(PriorityFIFO), "FIFO always scores zero, so it must always bucket as low")
+
+	barelyUrgent := Health{NumHealthyPieces: 9, PiecesRequired: 10}
+	require.Equal(t, "medium", barelyUrgent.Bucket(PriorityHealth))
+
+	veryUrgent := Health{NumHealthyPieces: 1, PiecesRequired: 10}
+	require.Equal(t, "critical", veryUrgent.Bucket(PriorityHealth))
+
+	// two segments with different health must not collapse to the same
+	// bucket just because the process-wide policy is identical.
+	require.NotEqual(t, barelyUrgent.Bucket(PriorityHealth), veryUrgent.Bucket(PriorityHealth))
+}
+
+func TestMemQueueSelectOrdersByPolicy(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemQueue()
+
+	urgent := &internalpb.InjuredSegment{Path: []byte("urgent")}
+	mild := &internalpb.InjuredSegment{Path: []byte("mild")}
+
+	require.NoError(t, q.Insert(ctx, mild, Health{NumHealthyPieces: 8, PiecesRequired: 10}))
+	require.NoError(t, q.Insert(ctx, urgent, Health{NumHealthyPieces: 2, PiecesRequired: 10}))
+
+	selected, err := q.Select(ctx, PriorityHealth)
+	require.NoError(t, err)
+	require.Equal(t, "urgent", string(selected.GetPath()))
+}
+
+func TestMemQueueSelectEmpty(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemQueue()
+
+	_, err := q.Select(ctx, PriorityFIFO)
+	require.Error(t, err)
+	require.True(t, storage.ErrEmptyQueue.Has(err))
+}
+
+func TestMemQueueRescheduleRespectsNotBefore(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemQueue()
+
+	seg := &internalpb.InjuredSegment{Path: []byte("backoff-me")}
+	require.NoError(t, q.Insert(ctx, seg, Health{}))
+
+	queued, err := q.Select(ctx, PriorityFIFO)
+	require.NoError(t, err)
+
+	require.NoError(t, q.Reschedule(ctx, queued, time.Now().Add(time.Hour)))
+
+	_, err = q.Select(ctx, PriorityFIFO)
+	require.Error(t, err)
+	require.True(t, storage.ErrEmptyQueue.Has(err))
+}
+
+func TestMemQueueDeadLetterRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemQueue()
+
+	seg := &internalpb.InjuredSegment{Path: []byte("doomed")}
+	require.NoError(t, q.Insert(ctx, seg, Health{}))
+
+	queued, err := q.Select(ctx, PriorityFIFO)
+	require.NoError(t, err)
+
+	require.NoError(t, q.MoveToDeadLetter(ctx, queued, "too many attempts"))
+
+	dead, err := q.ListDeadLetter(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	require.Equal(t, "too many attempts", dead[0].DeadLetterReason)
+
+	_, err = q.Select(ctx, PriorityFIFO)
+	require.Error(t, err, "segment should no longer be selectable while dead-lettered")
+
+	require.NoError(t, q.RetryDeadLetter(ctx, "doomed"))
+
+	dead, err = q.ListDeadLetter(ctx, 0)
+	require.NoError(t, err)
+	require.Empty(t, dead)
+
+	retried, err := q.Select(ctx, PriorityFIFO)
+	require.NoError(t, err)
+	require.Equal(t, "doomed", string(retried.GetPath()))
+	require.Equal(t, 0, retried.AttemptCount)
+}
+
+func TestMemQueueRetryDeadLetterNotFound(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemQueue()
+
+	err := q.RetryDeadLetter(ctx, "nonexistent")
+	require.Error(t, err)
+	require.True(t, Error.Has(err))
+}
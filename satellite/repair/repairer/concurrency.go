@@ -0,0 +1,172 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package repairer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Outcome describes how a single repair job finished, for feeding back into
+// a ConcurrencyController.
+type Outcome struct {
+	Success  bool
+	TimedOut bool
+	Latency  time.Duration
+}
+
+// ConcurrencyController decides how many repair jobs may run at once, and
+// adjusts that limit over time based on the outcomes reported to it.
+//
+// architecture: Service
+type ConcurrencyController interface {
+	// Acquire blocks until a repair slot is available or ctx is done.
+	Acquire(ctx context.Context) error
+	// Release returns a slot previously obtained from Acquire.
+	Release()
+	// Report feeds the outcome of a finished repair job back into the
+	// controller so it can grow or shrink the effective limit.
+	Report(outcome Outcome)
+	// Limit returns the current effective concurrency limit.
+	Limit() int
+	// Drain blocks until every outstanding slot has been released.
+	Drain()
+}
+
+// aimdController is the default ConcurrencyController. It grows the
+// effective limit by one slot on success (additive increase) and halves it,
+// down to a configured floor, when a job fails or times out (multiplicative
+// decrease).
+type aimdController struct {
+	tokens      chan struct{}
+	max         int
+	min         int
+	outstanding sync.WaitGroup // tracks slots currently checked out via Acquire, across any number of resizes
+
+	mu    sync.Mutex
+	limit int
+	debt  int // slots removed from rotation that are owed back on the next Release
+}
+
+// NewAIMDController returns a ConcurrencyController that starts at initial
+// concurrent slots and adapts between min and max based on reported repair
+// outcomes.
+func NewAIMDController(initial, min, max int) ConcurrencyController {
+	if max < min {
+		max = min
+	}
+	if initial < min {
+		initial = min
+	}
+	if initial > max {
+		initial = max
+	}
+
+	c := &aimdController{
+		tokens: make(chan struct{}, max),
+		max:    max,
+		min:    min,
+		limit:  initial,
+	}
+	for i := 0; i < initial; i++ {
+		c.tokens <- struct{}{}
+	}
+	reportConcurrencyLimit(initial)
+	return c
+}
+
+func (c *aimdController) Acquire(ctx context.Context) error {
+	select {
+	case <-c.tokens:
+		c.outstanding.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *aimdController) Release() {
+	defer c.outstanding.Done()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.debt > 0 {
+		c.debt--
+		return
+	}
+	c.tokens <- struct{}{}
+}
+
+func (c *aimdController) Limit() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limit
+}
+
+func (c *aimdController) Report(outcome Outcome) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !outcome.Success || outcome.TimedOut {
+		c.shrinkLocked()
+		return
+	}
+	c.growLocked()
+}
+
+// shrinkLocked halves the effective limit, down to c.min, by pulling spare
+// slots out of rotation. Slots that are currently checked out are marked as
+// debt and removed the next time they're released instead.
+func (c *aimdController) shrinkLocked() {
+	newLimit := c.limit / 2
+	if newLimit < c.min {
+		newLimit = c.min
+	}
+	delta := c.limit - newLimit
+	for i := 0; i < delta; i++ {
+		select {
+		case <-c.tokens:
+		default:
+			c.debt++
+		}
+	}
+	if delta > 0 {
+		c.limit = newLimit
+		reportConcurrencyShed()
+		reportConcurrencyLimit(c.limit)
+	}
+}
+
+// growLocked increases the effective limit by one slot, up to c.max.
+func (c *aimdController) growLocked() {
+	if c.limit >= c.max {
+		return
+	}
+	if c.debt > 0 {
+		c.debt--
+	} else {
+		c.tokens <- struct{}{}
+	}
+	c.limit++
+	reportConcurrencyLimit(c.limit)
+}
+
+// Drain waits until every slot ever handed out by Acquire has been
+// released. Unlike a scheme based on c.limit, this stays correct across
+// shrink events: a slot checked out before a shrink is still outstanding
+// (even though it may now count against debt instead of the token
+// channel) until its Release is actually observed.
+func (c *aimdController) Drain() {
+	c.outstanding.Wait()
+}
+
+func reportConcurrencyLimit(limit int) {
+	mon.IntVal("repair_concurrency_limit").Observe(int64(limit)) //mon:locked
+}
+
+func reportConcurrencyShed() {
+	mon.Counter("repair_concurrency_shed_events").Inc(1) //mon:locked
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package repairer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAIMDControllerGrowsOnSuccess(t *testing.T) {
+	ctx := context.Background()
+	c := NewAIMDController(1, 1, 4)
+	require.Equal(t, 1, c.Limit())
+
+	require.NoError(t, c.Acquire(ctx))
+	c.Release()
+	c.Report(Outcome{Success: true})
+	require.Equal(t, 2, c.Limit())
+}
+
+func TestAIMDControllerShrinksOnFailure(t *testing.T) {
+	ctx := context.Background()
+	c := NewAIMDController(4, 1, 4)
+	require.Equal(t, 4, c.Limit())
+
+	require.NoError(t, c.Acquire(ctx))
+	c.Release()
+	c.Report(Outcome{Success: false})
+	require.Equal(t, 2, c.Limit())
+
+	c.Report(Outcome{TimedOut: true})
+	require.Equal(t, 1, c.Limit())
+
+	// already at the floor; further shrinks must not go below min.
+	c.Report(Outcome{Success: false})
+	require.Equal(t, 1, c.Limit())
+}
+
+func TestAIMDControllerDrainWaitsForOutstandingAcquisitions(t *testing.T) {
+	ctx := context.Background()
+	c := NewAIMDController(4, 1, 4)
+
+	// check out 3 of the 4 slots, leaving only 1 spare token in the channel.
+	require.NoError(t, c.Acquire(ctx))
+	require.NoError(t, c.Acquire(ctx))
+	require.NoError(t, c.Acquire(ctx))
+
+	// shrinking to 2 can only pull the 1 spare token out of the channel; the
+	// remaining unit of the shrink becomes debt, since 2 of the 3 checked-out
+	// slots are still legitimately in use.
+	c.Report(Outcome{Success: false})
+	require.Equal(t, 2, c.Limit())
+
+	drained := make(chan struct{})
+	go func() {
+		c.Drain()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		t.Fatal("Drain returned while acquisitions from before the shrink were still outstanding")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() { defer wg.Done(); c.Release() }()
+	go func() { defer wg.Done(); c.Release() }()
+	go func() { defer wg.Done(); c.Release() }()
+	wg.Wait()
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("Drain did not return after all outstanding acquisitions were released")
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package repairer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+
+	"storj.io/storj/satellite/repair/queue"
+	"storj.io/storj/storage"
+)
+
+// backoffBase and backoffMax bound the exponential backoff applied to a
+// segment that repeatedly fails to repair for reasons other than being
+// irreparable.
+const (
+	backoffBase = 30 * time.Second
+	backoffMax  = 6 * time.Hour
+)
+
+// errorClass roughly categorizes a repair failure, so operators can tell
+// from the logs whether a backing-off segment is being hit by flaky
+// network conditions, local resource pressure, or a bug.
+type errorClass string
+
+const (
+	errorClassNetwork  errorClass = "network"
+	errorClassResource errorClass = "resource"
+	errorClassLogic    errorClass = "logic"
+)
+
+// logicErrorMaxAttempts caps how many times a segment that fails with an
+// errorClassLogic error is retried before being dead-lettered, regardless
+// of Config.MaxAttempts. A logic error implies a deterministic bug rather
+// than a transient condition, so retrying it on the usual backoff schedule
+// just delays an inevitable dead-letter with no chance of success.
+const logicErrorMaxAttempts = 1
+
+// maxAttemptsFor returns how many attempts a segment failing with class
+// gets before handleRetryableFailure gives up on it, given the
+// operator-configured ceiling for ordinary (network/resource) failures.
+func maxAttemptsFor(class errorClass, configured int) int {
+	if class == errorClassLogic && configured > logicErrorMaxAttempts {
+		return logicErrorMaxAttempts
+	}
+	return configured
+}
+
+// classifyError makes a best-effort guess at why a repair attempt failed.
+// It only needs to be good enough to choose between backing off and giving
+// up; it does not need to be exhaustive.
+func classifyError(err error) errorClass {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return errorClassNetwork
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return errorClassNetwork
+	}
+	if storage.ErrEmptyQueue.Has(err) {
+		return errorClassResource
+	}
+	return errorClassLogic
+}
+
+// backoffDuration returns how long a segment should wait before its next
+// repair attempt, given how many attempts have already been made.
+func backoffDuration(attempt int) time.Duration {
+	if attempt < 0 {
+		attempt = 0
+	}
+	if attempt > 10 { // guard against overflowing the shift below
+		return backoffMax
+	}
+	d := backoffBase << uint(attempt)
+	if d <= 0 || d > backoffMax {
+		return backoffMax
+	}
+	return d
+}
+
+// handleRetryableFailure decides whether a failed, non-irreparable repair
+// attempt should be retried with backoff or given up on and moved to the
+// dead letter queue, and tells the queue to do so. It is responsible for
+// advancing seg's attempt count; callers must not increment it themselves.
+func (service *Service) handleRetryableFailure(ctx context.Context, seg *queue.QueuedSegment, repairErr error) error {
+	class := classifyError(repairErr)
+	path := string(seg.GetPath())
+
+	seg.AttemptCount++
+	attempt := seg.AttemptCount
+
+	threshold := maxAttemptsFor(class, service.config.MaxAttempts)
+	if attempt >= threshold {
+		service.log.Error("segment exceeded max repair attempts, moving to dead letter queue",
+			zap.String("path", path), zap.Int("attempts", attempt), zap.Int("threshold", threshold),
+			zap.String("class", string(class)), zap.Error(repairErr))
+		if err := service.queue.MoveToDeadLetter(ctx, seg, repairErr.Error()); err != nil {
+			return Error.New("failed to move segment to dead letter queue: %v", err)
+		}
+		return nil
+	}
+
+	notBefore := time.Now().Add(backoffDuration(attempt))
+	service.log.Info("rescheduling segment after repair failure",
+		zap.String("path", path), zap.Int("attempts", attempt),
+		zap.String("class", string(class)), zap.Time("not_before", notBefore))
+	if err := service.queue.Reschedule(ctx, seg, notBefore); err != nil {
+		return Error.New("failed to reschedule segment: %v", err)
+	}
+	return nil
+}
+
+// AdminDeadLetterService exposes read and manual-retry access to the
+// repair dead letter queue for the satellite admin API.
+//
+// This is not yet reachable over DRPC: that needs a
+// ListDeadLetterRequest/Response and RetryDeadLetterRequest/Response added
+// to the admin proto, a DRPCRepairAdminServer regenerated from it, and an
+// endpoint wrapping this service registered against the result, none of
+// which is in scope for this chunk. Call its methods directly in-process
+// until that lands.
+type AdminDeadLetterService struct {
+	queue queue.RepairQueue
+}
+
+// NewAdminDeadLetterService creates a new AdminDeadLetterService.
+func NewAdminDeadLetterService(queue queue.RepairQueue) *AdminDeadLetterService {
+	return &AdminDeadLetterService{queue: queue}
+}
+
+// List returns dead-lettered segments for inspection.
+func (admin *AdminDeadLetterService) List(ctx context.Context, limit int) ([]*queue.QueuedSegment, error) {
+	return admin.queue.ListDeadLetter(ctx, limit)
+}
+
+// Retry moves a dead-lettered segment back onto the repair queue for
+// another attempt.
+func (admin *AdminDeadLetterService) Retry(ctx context.Context, path string) error {
+	return admin.queue.RetryDeadLetter(ctx, path)
+}
@@ -0,0 +1,118 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package repairer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"storj.io/storj/satellite/internalpb"
+	"storj.io/storj/satellite/repair/queue"
+	"storj.io/storj/storage"
+)
+
+func TestClassifyError(t *testing.T) {
+	require.Equal(t, errorClassNetwork, classifyError(context.DeadlineExceeded))
+	require.Equal(t, errorClassResource, classifyError(storage.ErrEmptyQueue.New("empty")))
+	require.Equal(t, errorClassLogic, classifyError(Error.New("something else")))
+}
+
+func TestBackoffDurationGrowsAndCaps(t *testing.T) {
+	require.Equal(t, backoffBase, backoffDuration(0))
+	require.Equal(t, 2*backoffBase, backoffDuration(1))
+	require.Equal(t, backoffMax, backoffDuration(100))
+}
+
+func TestMaxAttemptsForLowersThresholdForLogicErrors(t *testing.T) {
+	require.Equal(t, 5, maxAttemptsFor(errorClassNetwork, 5))
+	require.Equal(t, 5, maxAttemptsFor(errorClassResource, 5))
+	require.Equal(t, logicErrorMaxAttempts, maxAttemptsFor(errorClassLogic, 5))
+
+	// a configured ceiling already below the logic-error cap must not be
+	// raised.
+	require.Equal(t, 1, maxAttemptsFor(errorClassLogic, 1))
+}
+
+// fakeDeadLetterQueue is a minimal queue.RepairQueue that only implements
+// the methods handleRetryableFailure needs, so tests don't have to depend
+// on memQueue's selection semantics.
+type fakeDeadLetterQueue struct {
+	queue.RepairQueue
+
+	rescheduled  []*queue.QueuedSegment
+	deadLettered []*queue.QueuedSegment
+}
+
+func (f *fakeDeadLetterQueue) Reschedule(ctx context.Context, seg *queue.QueuedSegment, notBefore time.Time) error {
+	f.rescheduled = append(f.rescheduled, seg)
+	return nil
+}
+
+func (f *fakeDeadLetterQueue) MoveToDeadLetter(ctx context.Context, seg *queue.QueuedSegment, reason string) error {
+	f.deadLettered = append(f.deadLettered, seg)
+	return nil
+}
+
+func TestHandleRetryableFailureIncrementsAttemptCount(t *testing.T) {
+	ctx := context.Background()
+	fq := &fakeDeadLetterQueue{}
+	service := &Service{
+		log:    zap.NewNop(),
+		queue:  fq,
+		config: &Config{MaxAttempts: 3},
+	}
+
+	seg := &queue.QueuedSegment{InjuredSegment: &internalpb.InjuredSegment{Path: []byte("flaky")}}
+
+	// a network-classed error keeps the full configured MaxAttempts budget.
+	require.NoError(t, service.handleRetryableFailure(ctx, seg, context.DeadlineExceeded))
+	require.Equal(t, 1, seg.AttemptCount)
+	require.Len(t, fq.rescheduled, 1)
+	require.Empty(t, fq.deadLettered)
+
+	require.NoError(t, service.handleRetryableFailure(ctx, seg, context.DeadlineExceeded))
+	require.Equal(t, 2, seg.AttemptCount)
+	require.Len(t, fq.rescheduled, 2)
+	require.Empty(t, fq.deadLettered)
+}
+
+func TestHandleRetryableFailureMovesToDeadLetterAtMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	fq := &fakeDeadLetterQueue{}
+	service := &Service{
+		log:    zap.NewNop(),
+		queue:  fq,
+		config: &Config{MaxAttempts: 2},
+	}
+
+	seg := &queue.QueuedSegment{InjuredSegment: &internalpb.InjuredSegment{Path: []byte("doomed")}, AttemptCount: 1}
+
+	require.NoError(t, service.handleRetryableFailure(ctx, seg, context.DeadlineExceeded))
+	require.Equal(t, 2, seg.AttemptCount)
+	require.Empty(t, fq.rescheduled)
+	require.Len(t, fq.deadLettered, 1)
+}
+
+func TestHandleRetryableFailureDeadLettersLogicErrorsImmediately(t *testing.T) {
+	ctx := context.Background()
+	fq := &fakeDeadLetterQueue{}
+	service := &Service{
+		log:   zap.NewNop(),
+		queue: fq,
+		// a generous budget for ordinary failures; a logic-classed error
+		// must still be dead-lettered well before this is exhausted.
+		config: &Config{MaxAttempts: 10},
+	}
+
+	seg := &queue.QueuedSegment{InjuredSegment: &internalpb.InjuredSegment{Path: []byte("buggy")}}
+
+	require.NoError(t, service.handleRetryableFailure(ctx, seg, Error.New("deterministic bug")))
+	require.Equal(t, 1, seg.AttemptCount)
+	require.Empty(t, fq.rescheduled)
+	require.Len(t, fq.deadLettered, 1)
+}
@@ -0,0 +1,226 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package repairer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// journalCompactInterval is how often a RepairJournal's compaction routine
+// runs while the service is up.
+const journalCompactInterval = 24 * time.Hour
+
+// journalCommittedRetention is how long a committed checkpoint is kept
+// around before compaction removes it. Keeping committed entries briefly
+// makes a restart's replay log easier to read; there's no correctness
+// reason to keep them longer.
+const journalCommittedRetention = time.Hour
+
+// JobState is a state a repair job passes through over its lifetime.
+// SegmentRepairer is intended to record a checkpoint after each expensive
+// phase, but today only Service records JobSelected and JobCommitted (see
+// Service.worker); the JobPiecesDownloaded/JobPiecesUploaded checkpoints
+// below are defined for that future instrumentation but nothing currently
+// records them, so a restart cannot yet resume a job from the middle of a
+// repair — see replayJournal for what actually happens today.
+type JobState string
+
+const (
+	// JobSelected means the segment was popped off the repair queue and a
+	// worker has started on it.
+	JobSelected JobState = "selected"
+	// JobPiecesDownloaded means the healthy pieces needed for repair have
+	// all been downloaded.
+	JobPiecesDownloaded JobState = "pieces-downloaded"
+	// JobPiecesUploaded means the repaired pieces have all been uploaded to
+	// their new storage nodes.
+	JobPiecesUploaded JobState = "pieces-uploaded"
+	// JobCommitted means the repaired pointer was committed to the
+	// metainfo db and the job is done.
+	JobCommitted JobState = "committed"
+)
+
+// RepairJournal records repair job state transitions to durable storage,
+// keyed by segment path, giving operators visibility into which jobs were
+// in flight across a satellite restart. It does not currently let a
+// restarted job resume mid-repair; see the JobState doc and replayJournal
+// for why.
+type RepairJournal interface {
+	// Record durably persists that the segment at path has reached state.
+	Record(ctx context.Context, path string, state JobState) error
+	// Pending returns the last recorded state of every segment that has
+	// not reached JobCommitted.
+	Pending(ctx context.Context) (map[string]JobState, error)
+	// Flush blocks until every previously accepted Record call is durable.
+	Flush(ctx context.Context) error
+	// Compact removes journal entries for committed jobs once they are
+	// older than their retention window.
+	Compact(ctx context.Context) error
+}
+
+type checkpointContextKey struct{}
+
+// WithCheckpointRecorder attaches a checkpoint recorder to ctx, so that
+// SegmentRepairer can look it up with CheckpointRecorderFromContext and
+// call it after each expensive repair phase completes. As of this chunk
+// nothing in SegmentRepairer.Repair actually does so; see JobState's doc
+// for the current state of mid-job checkpointing.
+func WithCheckpointRecorder(ctx context.Context, record func(JobState) error) context.Context {
+	return context.WithValue(ctx, checkpointContextKey{}, record)
+}
+
+// CheckpointRecorderFromContext returns the recorder attached to ctx by
+// WithCheckpointRecorder, or a no-op if none was attached.
+func CheckpointRecorderFromContext(ctx context.Context) func(JobState) error {
+	if record, ok := ctx.Value(checkpointContextKey{}).(func(JobState) error); ok {
+		return record
+	}
+	return func(JobState) error { return nil }
+}
+
+// noopJournal is used when Config.JournalDir is empty, so Service doesn't
+// need to special-case a disabled journal.
+type noopJournal struct{}
+
+func (noopJournal) Record(ctx context.Context, path string, state JobState) error { return nil }
+func (noopJournal) Pending(ctx context.Context) (map[string]JobState, error)      { return nil, nil }
+func (noopJournal) Flush(ctx context.Context) error                              { return nil }
+func (noopJournal) Compact(ctx context.Context) error                            { return nil }
+
+// fileJournal is the default RepairJournal, backed by one small file per
+// segment under Config.JournalDir.
+type fileJournal struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[string]journalEntry // keyed by segment path
+}
+
+type journalEntry struct {
+	State     JobState  `json:"state"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewFileJournal returns a RepairJournal that persists checkpoints as files
+// under dir, loading any checkpoints already present from a previous run.
+func NewFileJournal(dir string) (RepairJournal, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	j := &fileJournal{dir: dir, entries: make(map[string]journalEntry)}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *fileJournal) load() error {
+	files, err := os.ReadDir(j.dir)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(j.dir, f.Name()))
+		if err != nil {
+			return Error.Wrap(err)
+		}
+		var record struct {
+			Path  string `json:"path"`
+			Entry journalEntry
+		}
+		if err := json.Unmarshal(data, &record); err != nil {
+			return Error.Wrap(err)
+		}
+		j.entries[record.Path] = record.Entry
+	}
+	return nil
+}
+
+func (j *fileJournal) Record(ctx context.Context, path string, state JobState) error {
+	entry := journalEntry{State: state, UpdatedAt: time.Now().UTC()}
+
+	record := struct {
+		Path  string `json:"path"`
+		Entry journalEntry
+	}{Path: path, Entry: entry}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	filename := filepath.Join(j.dir, journalFilename(path))
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return Error.Wrap(err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return Error.Wrap(err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries[path] = entry
+	return nil
+}
+
+func (j *fileJournal) Pending(ctx context.Context) (map[string]JobState, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	pending := make(map[string]JobState)
+	for path, entry := range j.entries {
+		if entry.State != JobCommitted {
+			pending[path] = entry.State
+		}
+	}
+	return pending, nil
+}
+
+// Flush is a no-op: Record writes and renames synchronously, so every
+// completed Record call is already durable by the time it returns.
+func (j *fileJournal) Flush(ctx context.Context) error { return nil }
+
+func (j *fileJournal) Compact(ctx context.Context) error {
+	j.mu.Lock()
+	cutoff := time.Now().Add(-journalCommittedRetention)
+	var stale []string
+	for path, entry := range j.entries {
+		if entry.State == JobCommitted && entry.UpdatedAt.Before(cutoff) {
+			stale = append(stale, path)
+		}
+	}
+	j.mu.Unlock()
+
+	for _, path := range stale {
+		if err := os.Remove(filepath.Join(j.dir, journalFilename(path))); err != nil && !os.IsNotExist(err) {
+			return Error.Wrap(err)
+		}
+		j.mu.Lock()
+		delete(j.entries, path)
+		j.mu.Unlock()
+	}
+	return nil
+}
+
+// journalFilename derives a filesystem-safe filename for a segment path.
+func journalFilename(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
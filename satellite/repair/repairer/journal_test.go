@@ -0,0 +1,124 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package repairer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileJournalRecordAndPending(t *testing.T) {
+	ctx := context.Background()
+	journal, err := NewFileJournal(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, journal.Record(ctx, "segment/a", JobSelected))
+	require.NoError(t, journal.Record(ctx, "segment/b", JobSelected))
+	require.NoError(t, journal.Record(ctx, "segment/b", JobCommitted))
+
+	pending, err := journal.Pending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]JobState{"segment/a": JobSelected}, pending)
+}
+
+func TestFileJournalSurvivesReload(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	first, err := NewFileJournal(dir)
+	require.NoError(t, err)
+	require.NoError(t, first.Record(ctx, "segment/a", JobPiecesUploaded))
+
+	second, err := NewFileJournal(dir)
+	require.NoError(t, err)
+
+	pending, err := second.Pending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]JobState{"segment/a": JobPiecesUploaded}, pending)
+}
+
+func TestFileJournalCompactRemovesOnlyStaleCommitted(t *testing.T) {
+	ctx := context.Background()
+	journal, err := NewFileJournal(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, journal.Record(ctx, "segment/in-flight", JobSelected))
+	require.NoError(t, journal.Record(ctx, "segment/done", JobCommitted))
+
+	// a freshly committed entry is within the retention window and must
+	// survive a compaction pass.
+	require.NoError(t, journal.Compact(ctx))
+
+	pending, err := journal.Pending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]JobState{"segment/in-flight": JobSelected}, pending)
+
+	fj := journal.(*fileJournal)
+	fj.mu.Lock()
+	_, stillPresent := fj.entries["segment/done"]
+	fj.mu.Unlock()
+	require.True(t, stillPresent, "Compact must keep a committed entry that is within its retention window")
+}
+
+func TestFileJournalCompactRemovesStaleCommittedFromMapAndDisk(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	journal, err := NewFileJournal(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, journal.Record(ctx, "segment/stale", JobCommitted))
+
+	staleFile := filepath.Join(dir, journalFilename("segment/stale"))
+	_, err = os.Stat(staleFile)
+	require.NoError(t, err, "Record must have written the entry to disk")
+
+	// backdate the in-memory entry past journalCommittedRetention, the way
+	// a real committed job would look after being left alone long enough;
+	// Record itself has no way to set an arbitrary UpdatedAt, so poke the
+	// unexported field directly since this test is in-package.
+	fj := journal.(*fileJournal)
+	fj.mu.Lock()
+	fj.entries["segment/stale"] = journalEntry{
+		State:     JobCommitted,
+		UpdatedAt: time.Now().Add(-journalCommittedRetention - time.Minute),
+	}
+	fj.mu.Unlock()
+
+	require.NoError(t, journal.Compact(ctx))
+
+	pending, err := journal.Pending(ctx)
+	require.NoError(t, err)
+	require.Empty(t, pending, "a stale committed entry has no state to report as pending")
+
+	fj.mu.Lock()
+	_, stillPresent := fj.entries["segment/stale"]
+	fj.mu.Unlock()
+	require.False(t, stillPresent, "Compact must remove the stale entry from the in-memory map")
+
+	_, err = os.Stat(staleFile)
+	require.True(t, os.IsNotExist(err), "Compact must remove the stale entry's file on disk")
+}
+
+func TestCheckpointRecorderFromContextDefaultsToNoop(t *testing.T) {
+	record := CheckpointRecorderFromContext(context.Background())
+	require.NoError(t, record(JobPiecesDownloaded))
+}
+
+func TestWithCheckpointRecorderRoundTrips(t *testing.T) {
+	var recorded []JobState
+	ctx := WithCheckpointRecorder(context.Background(), func(state JobState) error {
+		recorded = append(recorded, state)
+		return nil
+	})
+
+	record := CheckpointRecorderFromContext(ctx)
+	require.NoError(t, record(JobPiecesDownloaded))
+	require.NoError(t, record(JobPiecesUploaded))
+	require.Equal(t, []JobState{JobPiecesDownloaded, JobPiecesUploaded}, recorded)
+}
@@ -0,0 +1,19 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package repairer
+
+import (
+	"github.com/spacemonkeygo/monkit/v3"
+
+	"storj.io/storj/satellite/repair/queue"
+)
+
+// observeRepairDuration reports time_for_repair tagged with the repaired
+// segment's own urgency bucket (derived from its health snapshot under the
+// active policy), so operators can see repair latency distribution by
+// per-segment urgency rather than a single aggregate number or a constant
+// label naming the process-wide policy.
+func observeRepairDuration(policy queue.PriorityPolicy, health queue.Health, seconds float64) {
+	mon.FloatValTagged("time_for_repair", monkit.NewSeriesTag("priority_bucket", health.Bucket(policy))).Observe(seconds) //mon:locked
+}
@@ -0,0 +1,29 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package repairer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/storj/satellite/repair/queue"
+)
+
+func TestObserveRepairDurationTagsByPerSegmentHealthNotPolicy(t *testing.T) {
+	// observeRepairDuration previously tagged every observation with the
+	// static, process-wide PriorityPolicy string, so two segments repaired
+	// under the same policy but wildly different health would report under
+	// the identical tag. Guard the fix by asserting the bucket it derives
+	// differs per segment even though the policy argument is the same.
+	urgent := queue.Health{NumHealthyPieces: 1, PiecesRequired: 10}
+	mild := queue.Health{NumHealthyPieces: 9, PiecesRequired: 10}
+	require.NotEqual(t, urgent.Bucket(queue.PriorityHealth), mild.Bucket(queue.PriorityHealth))
+
+	// exercise the actual call path; it must not panic for any policy/health
+	// combination, including the FIFO policy where Score is always zero.
+	observeRepairDuration(queue.PriorityHealth, urgent, 1.23)
+	observeRepairDuration(queue.PriorityHealth, mild, 1.23)
+	observeRepairDuration(queue.PriorityFIFO, queue.Health{}, 1.23)
+}
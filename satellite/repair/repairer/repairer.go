@@ -5,12 +5,12 @@ package repairer
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/spacemonkeygo/monkit/v3"
 	"github.com/zeebo/errs"
 	"go.uber.org/zap"
-	"golang.org/x/sync/semaphore"
 
 	"storj.io/common/memory"
 	"storj.io/common/sync2"
@@ -36,31 +36,63 @@ type Config struct {
 	MaxBufferMem                  memory.Size   `help:"maximum buffer memory (in bytes) to be allocated for read buffers" default:"4M"`
 	MaxExcessRateOptimalThreshold float64       `help:"ratio applied to the optimal threshold to calculate the excess of the maximum number of repaired pieces to upload" default:"0.05"`
 	InMemoryRepair                bool          `help:"whether to download pieces for repair in memory (true) or download to disk (false)" default:"false"`
+	PriorityPolicy                string        `help:"policy used to order the repair queue: \"fifo\", \"health\", or \"weighted\"" default:"fifo"`
+	MinRepair                     int           `help:"minimum concurrent repair jobs the adaptive controller will shrink to" releaseDefault:"1" devDefault:"1"`
+	MaxRepairCeiling              int           `help:"maximum concurrent repair jobs the adaptive controller may grow to" releaseDefault:"50" devDefault:"5"`
+	JournalDir                    string        `help:"directory used to persist repair job lifecycle checkpoints, so operators can see which jobs were in flight across a restart; disabled if empty"`
+	MaxAttempts                   int           `help:"number of times a segment may fail repair with a network or resource error before it is moved to the dead letter queue; a logic error moves it after the first failure" default:"5"`
 }
 
 // Service contains the information needed to run the repair service
 //
 // architecture: Worker
 type Service struct {
-	log        *zap.Logger
-	queue      queue.RepairQueue
-	config     *Config
-	JobLimiter *semaphore.Weighted
-	Loop       *sync2.Cycle
-	repairer   *SegmentRepairer
-	irrDB      irreparable.DB
+	log            *zap.Logger
+	queue          queue.RepairQueue
+	config         *Config
+	priorityPolicy queue.PriorityPolicy
+	Concurrency    ConcurrencyController
+	journal        RepairJournal
+	Loop           *sync2.Cycle
+	repairer       *SegmentRepairer
+	irrDB          irreparable.DB
 }
 
 // NewService creates repairing service.
 func NewService(log *zap.Logger, queue queue.RepairQueue, config *Config, repairer *SegmentRepairer, irrDB irreparable.DB) *Service {
+	return NewServiceWithConcurrency(log, queue, config, repairer, irrDB,
+		NewAIMDController(config.MaxRepair, config.MinRepair, config.MaxRepairCeiling))
+}
+
+// NewServiceWithConcurrency creates a repairing service using the given
+// ConcurrencyController instead of the default AIMD controller. This is
+// primarily useful for tests that want deterministic concurrency behavior.
+func NewServiceWithConcurrency(log *zap.Logger, repairQueue queue.RepairQueue, config *Config, repairer *SegmentRepairer, irrDB irreparable.DB, concurrency ConcurrencyController) *Service {
+	policy := queue.PriorityPolicy(config.PriorityPolicy)
+	if policy == "" {
+		policy = queue.PriorityFIFO
+	}
+
+	var journal RepairJournal = noopJournal{}
+	if config.JournalDir != "" {
+		fileJournal, err := NewFileJournal(config.JournalDir)
+		if err != nil {
+			log.Error("failed to open repair journal; checkpointing disabled", zap.Error(err))
+		} else {
+			journal = fileJournal
+		}
+	}
+
 	return &Service{
-		log:        log,
-		queue:      queue,
-		config:     config,
-		JobLimiter: semaphore.NewWeighted(int64(config.MaxRepair)),
-		Loop:       sync2.NewCycle(config.Interval),
-		repairer:   repairer,
-		irrDB:      irrDB,
+		log:            log,
+		queue:          repairQueue,
+		config:         config,
+		priorityPolicy: policy,
+		Concurrency:    concurrency,
+		journal:        journal,
+		Loop:           sync2.NewCycle(config.Interval),
+		repairer:       repairer,
+		irrDB:          irrDB,
 	}
 }
 
@@ -69,16 +101,13 @@ func (service *Service) Close() error { return nil }
 
 // WaitForPendingRepairs waits for all ongoing repairs to complete.
 //
-// NB: this assumes that service.config.MaxRepair will never be changed once this Service instance
-// is initialized. If that is not a valid assumption, we should keep a copy of its initial value to
-// use here instead.
+// This works across controller resizes: Drain waits until every slot handed
+// out by Acquire has been released, however the limit has changed since.
 func (service *Service) WaitForPendingRepairs() {
-	// Acquire and then release the entire capacity of the semaphore, ensuring that
-	// it is completely empty (or, at least it was empty at some point).
-	//
-	// No error return is possible here; context.Background() can't be canceled
-	_ = service.JobLimiter.Acquire(context.Background(), int64(service.config.MaxRepair))
-	service.JobLimiter.Release(int64(service.config.MaxRepair))
+	service.Concurrency.Drain()
+	if err := service.journal.Flush(context.Background()); err != nil {
+		service.log.Error("failed to flush repair journal", zap.Error(err))
+	}
 }
 
 // Run runs the repairer service.
@@ -88,9 +117,50 @@ func (service *Service) Run(ctx context.Context) (err error) {
 	// Wait for all repairs to complete
 	defer service.WaitForPendingRepairs()
 
+	if err := service.replayJournal(ctx); err != nil {
+		service.log.Error("failed to replay repair journal", zap.Error(err))
+	}
+
+	compactCycle := sync2.NewCycle(journalCompactInterval)
+	go func() {
+		_ = compactCycle.Run(ctx, func(ctx context.Context) error {
+			if err := service.journal.Compact(ctx); err != nil {
+				service.log.Error("failed to compact repair journal", zap.Error(err))
+			}
+			return nil
+		})
+	}()
+
 	return service.Loop.Run(ctx, service.processWhileQueueHasItems)
 }
 
+// replayJournal logs every job left in-flight by a previous process, for
+// crash visibility: operators can see what was running when the process
+// went down.
+//
+// This does not resume jobs mid-phase. The journal only gets as far as
+// recording JobSelected and JobCommitted today (see Service.worker);
+// SegmentRepairer.Repair itself does not call CheckpointRecorderFromContext
+// after its download, erasure-decode, and upload phases, so there is no
+// JobPiecesDownloaded or JobPiecesUploaded checkpoint to resume from.
+// Every job found here, regardless of its last recorded state, is simply
+// re-run from the start the next time it is popped off the queue. Mid-job
+// resumability would require instrumenting SegmentRepairer.Repair, which
+// lives outside the files touched by this chunk; until that lands, this
+// subsystem's deliverable is restart-time observability of in-flight
+// jobs, not resumability.
+func (service *Service) replayJournal(ctx context.Context) error {
+	pending, err := service.journal.Pending(ctx)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+	for path, state := range pending {
+		service.log.Info("found in-flight repair job from previous run; it will be retried from the start",
+			zap.String("path", path), zap.String("last_checkpoint", string(state)))
+	}
+	return nil
+}
+
 // processWhileQueueHasItems keeps calling process() until the queue is empty or something
 // else goes wrong in fetching from the queue.
 func (service *Service) processWhileQueueHasItems(ctx context.Context) error {
@@ -110,8 +180,8 @@ func (service *Service) processWhileQueueHasItems(ctx context.Context) error {
 func (service *Service) process(ctx context.Context) (err error) {
 	defer mon.Task()(&ctx)(&err)
 
-	// wait until we are allowed to spawn a new job
-	if err := service.JobLimiter.Acquire(ctx, 1); err != nil {
+	// wait until the concurrency controller has a slot free for us
+	if err := service.Concurrency.Acquire(ctx); err != nil {
 		return err
 	}
 
@@ -120,28 +190,38 @@ func (service *Service) process(ctx context.Context) (err error) {
 	// repair jobs being given up within some set interval after the time in the 'attempted'
 	// column in the queue table.
 	//
-	// This is the reason why we are using a semaphore in this somewhat awkward way instead of
-	// using a simpler sync2.Limiter pattern. We don't want this timeout to include the waiting
-	// time from the semaphore acquisition, but it _must_ include the queue fetch time. At the
-	// same time, we don't want to do the queue pop in a separate goroutine, because we want to
+	// This is the reason why we acquire a concurrency slot in this somewhat awkward way instead
+	// of doing it inside a simpler helper. We don't want this timeout to include the time spent
+	// waiting on Concurrency.Acquire, but it _must_ include the queue fetch time. At the same
+	// time, we don't want to do the queue pop in a separate goroutine, because we want to
 	// return from service.Run when queue fetch fails.
 	ctx, cancel := context.WithTimeout(ctx, service.config.TotalTimeout)
 
-	seg, err := service.queue.Select(ctx)
+	// the priority policy determines which segment the queue hands back first:
+	// "health" and "weighted" favor segments closest to the irreparable
+	// threshold over strict FIFO ordering.
+	seg, err := service.queue.Select(ctx, service.priorityPolicy)
 	if err != nil {
-		service.JobLimiter.Release(1)
+		service.Concurrency.Release()
 		cancel()
 		return err
 	}
 	service.log.Debug("Retrieved segment from repair queue")
 
-	// this goroutine inherits the JobLimiter semaphore acquisition and is now responsible
-	// for releasing it.
+	// this goroutine inherits the concurrency slot acquired above and is now
+	// responsible for releasing it.
 	go func() {
-		defer service.JobLimiter.Release(1)
+		defer service.Concurrency.Release()
 		defer cancel()
 
-		if err := service.worker(ctx, seg); err != nil {
+		start := time.Now()
+		err := service.worker(ctx, seg)
+		service.Concurrency.Report(Outcome{
+			Success:  err == nil,
+			TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+			Latency:  time.Since(start),
+		})
+		if err != nil {
 			service.log.Error("repair worker failed:", zap.Error(err))
 		}
 	}()
@@ -149,14 +229,22 @@ func (service *Service) process(ctx context.Context) (err error) {
 	return nil
 }
 
-func (service *Service) worker(ctx context.Context, seg *internalpb.InjuredSegment) (err error) {
+func (service *Service) worker(ctx context.Context, seg *queue.QueuedSegment) (err error) {
 	defer mon.Task()(&ctx)(&err)
 
 	workerStartTime := time.Now().UTC()
+	path := string(seg.GetPath())
+
+	if err := service.journal.Record(ctx, path, JobSelected); err != nil {
+		service.log.Warn("failed to record repair checkpoint", zap.Error(err))
+	}
+	ctx = WithCheckpointRecorder(ctx, func(state JobState) error {
+		return service.journal.Record(ctx, path, state)
+	})
 
 	service.log.Debug("Limiter running repair on segment")
 	// note that shouldDelete is used even in the case where err is not null
-	shouldDelete, err := service.repairer.Repair(ctx, string(seg.GetPath()))
+	shouldDelete, err := service.repairer.Repair(ctx, path)
 	if shouldDelete {
 		if irreparableErr, ok := err.(*irreparableError); ok {
 			service.log.Error("segment could not be repaired! adding to irreparableDB for more attention",
@@ -177,13 +265,23 @@ func (service *Service) worker(ctx context.Context, seg *internalpb.InjuredSegme
 				zap.Error(err))
 		} else {
 			service.log.Debug("removing repaired segment from repair queue")
+			if journalErr := service.journal.Record(ctx, path, JobCommitted); journalErr != nil {
+				service.log.Warn("failed to record repair checkpoint", zap.Error(journalErr))
+			}
 		}
 		if shouldDelete {
-			delErr := service.queue.Delete(ctx, seg)
+			delErr := service.queue.Delete(ctx, seg.InjuredSegment)
 			if delErr != nil {
 				err = errs.Combine(err, Error.New("failed to remove segment from queue: %v", delErr))
 			}
 		}
+	} else if err != nil {
+		// the segment was left in the queue by SegmentRepairer; back it off or,
+		// once it has failed too many times, give up and move it to the dead
+		// letter queue instead of retrying at the same cadence forever.
+		if handleErr := service.handleRetryableFailure(ctx, seg, err); handleErr != nil {
+			service.log.Error("failed to handle repair failure", zap.Error(handleErr))
+		}
 	}
 	if err != nil {
 		return Error.Wrap(err)
@@ -192,6 +290,7 @@ func (service *Service) worker(ctx context.Context, seg *internalpb.InjuredSegme
 	repairedTime := time.Now().UTC()
 	timeForRepair := repairedTime.Sub(workerStartTime)
 	mon.FloatVal("time_for_repair").Observe(timeForRepair.Seconds()) //mon:locked
+	observeRepairDuration(service.priorityPolicy, seg.Health, timeForRepair.Seconds())
 
 	insertedTime := seg.GetInsertedTime()
 	// do not send metrics if segment was added before the InsertedTime field was added